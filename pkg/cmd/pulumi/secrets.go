@@ -0,0 +1,143 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/pulumi/pulumi/pkg/v2/backend"
+	"github.com/pulumi/pulumi/pkg/v2/secrets"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource/config"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/workspace"
+)
+
+const possibleSecretsProviderChoices = "The type of the provider that should be used to encrypt and decrypt " +
+	"secrets (possible choices: default, passphrase, awskms, azurekeyvault, gcpkms, hashivault, or any scheme " +
+	"claimed by an installed pulumi-secrets-<scheme> plugin)"
+
+// validateSecretsProvider checks that secretsProvider names a provider this CLI can actually construct,
+// so a typo or a missing plugin fails fast instead of partway through a rotation.
+func validateSecretsProvider(secretsProvider string) error {
+	return secrets.ValidateProvider(secretsProvider)
+}
+
+// buildSecretsManagerState constructs a fresh secrets.Manager for secretsProvider against ps, the
+// stack's current (on-disk) project stack, and returns that manager along with a copy of ps rewritten
+// to describe it: the new provider, its freshly-minted state, and the legacy EncryptionSalt/EncryptedKey
+// fields cleared. The stack's existing encryption mode carries over (so a stack that opted into
+// `encryptionmode: envelope` keeps that preference across a --secrets-provider rotation), but the
+// provider's own state (e.g. a wrapped data encryption key) starts fresh, since this is a new provider
+// rather than a reload of the one already in place.
+//
+// Nothing is persisted here, deliberately: the returned *workspace.ProjectStack is only a description of
+// what the stack's secrets provider would become, so callers that still have re-encryption work left to
+// do (config, and maybe the checkpoint) can fail partway through without the on-disk
+// Pulumi.<stack>.yaml ever having pointed at a provider the ciphertext doesn't match yet. Callers save it
+// themselves, via saveProjectStack, once every step that can fail has already succeeded.
+//
+// "default" is special-cased: on the managed Pulumi Service backend it manages its own per-stack key
+// and never needs a passphrase, so that case defers to the stack's own DefaultSecretsManager instead of
+// this package's local, passphrase-backed "default" builtin, which only applies to DIY backends.
+func buildSecretsManagerState(
+	b backend.Backend, s backend.Stack, ps *workspace.ProjectStack, secretsProvider string,
+) (secrets.Manager, *workspace.ProjectStack, error) {
+	var sm secrets.Manager
+	var err error
+	if secretsProvider == "default" && b.SupportsOrganizations() {
+		sm, err = s.DefaultSecretsManager(ps)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "getting the service-managed default secrets provider")
+		}
+	} else {
+		sm, err = secrets.NewManagerWithState(secretsProvider, secrets.EncryptionMode(ps.EncryptionMode), nil)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "constructing secrets provider %q", secretsProvider)
+		}
+	}
+
+	newPs := *ps
+	newPs.SecretsProvider = secretsProvider
+	newPs.SecretsProviderState = sm.State()
+	newPs.EncryptionSalt = ""
+	newPs.EncryptedKey = ""
+
+	return sm, &newPs, nil
+}
+
+// getStackEncrypter reconstructs s's current secrets manager from the state persisted in
+// Pulumi.<stack>.yaml and returns its Encrypter.
+func getStackEncrypter(s backend.Stack) (config.Encrypter, error) {
+	sm, err := stackSecretsManager(s)
+	if err != nil {
+		return nil, err
+	}
+	return sm.Encrypter(), nil
+}
+
+// getStackDecrypter reconstructs s's current secrets manager from the state persisted in
+// Pulumi.<stack>.yaml and returns its Decrypter.
+func getStackDecrypter(s backend.Stack) (config.Decrypter, error) {
+	sm, err := stackSecretsManager(s)
+	if err != nil {
+		return nil, err
+	}
+	return sm.Decrypter(), nil
+}
+
+// stackSecretsManager rebuilds the secrets.Manager that s's Pulumi.<stack>.yaml currently describes: its
+// provider URL, its encryption mode, and whatever provider-specific state (a wrapped data encryption
+// key, a passphrase salt, ...) that provider previously persisted via Manager.State. "default" on the
+// managed Pulumi Service backend is special-cased the same way buildSecretsManagerState special-cases it.
+func stackSecretsManager(s backend.Stack) (secrets.Manager, error) {
+	ps, err := loadProjectStack(s)
+	if err != nil {
+		return nil, err
+	}
+	if ps.SecretsProvider == "default" && s.Backend().SupportsOrganizations() {
+		return s.DefaultSecretsManager(ps)
+	}
+	return secrets.NewManagerWithState(ps.SecretsProvider, effectiveEncryptionMode(ps), legacyProviderState(ps))
+}
+
+// effectiveEncryptionMode returns ps.EncryptionMode, promoted to envelope mode when a legacy
+// EncryptedKey is present but no mode was ever recorded: stacks rotated before `encryptionmode` existed
+// always wrapped a local data key exactly the way envelope mode does today, so treating them as direct
+// would decrypt their ciphertext with the wrong crypter.
+func effectiveEncryptionMode(ps *workspace.ProjectStack) secrets.EncryptionMode {
+	if ps.EncryptionMode == "" && ps.EncryptedKey != "" {
+		return secrets.EncryptionModeEnvelope
+	}
+	return secrets.EncryptionMode(ps.EncryptionMode)
+}
+
+// legacyProviderState reconstructs a provider's persisted state from a stack's legacy top-level
+// EncryptionSalt/EncryptedKey fields when SecretsProviderState hasn't been populated yet (a stack
+// rotated before that field existed), so the passphrase and cloud providers reuse the same key instead
+// of minting a new one out from under an already-encrypted stack.
+func legacyProviderState(ps *workspace.ProjectStack) json.RawMessage {
+	if len(ps.SecretsProviderState) > 0 {
+		return ps.SecretsProviderState
+	}
+	if ps.EncryptionSalt == "" && ps.EncryptedKey == "" {
+		return nil
+	}
+	state, _ := json.Marshal(struct {
+		Salt       string `json:"salt,omitempty"`
+		WrappedDEK string `json:"wrappeddek,omitempty"`
+	}{Salt: ps.EncryptionSalt, WrappedDEK: ps.EncryptedKey})
+	return state
+}
@@ -15,16 +15,40 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	survey "github.com/AlecAivazis/survey/v2"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
+	"github.com/pulumi/pulumi/pkg/v2/backend"
 	"github.com/pulumi/pulumi/pkg/v2/backend/display"
+	"github.com/pulumi/pulumi/pkg/v2/resource/stack"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource"
 	"github.com/pulumi/pulumi/sdk/v2/go/common/resource/config"
 	"github.com/pulumi/pulumi/sdk/v2/go/common/util/cmdutil"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/workspace"
 )
 
 func changeSecretsProviderCmd() *cobra.Command {
 	var secretsProvider string
+	var includeSnapshot bool
+	var configOnly bool
+	var dryRun bool
+	var backup bool
+	var all bool
+	var org string
+	var stacksGlob string
+	var parallel int
 	var cmd = &cobra.Command{
 		Use:   "change-secrets-provider",
 		Short: "Change the secrets provider for the current stack",
@@ -47,16 +71,54 @@ func changeSecretsProviderCmd() *cobra.Command {
 			"* `pulumi stack change-secrets-provider " +
 			"--secrets-provider=\"gcpkms://projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>\"`\n" +
 			"* `pulumi stack change-secrets-provider " +
-			"--secrets-provider=\"hashivault://mykey\"`",
+			"--secrets-provider=\"hashivault://mykey\"`\n" +
+			"\n" +
+			"By default, only the stack's `Pulumi.<stack>.yaml` config is re-encrypted. Pass `--include-snapshot` to\n" +
+			"also walk the stack's checkpoint and re-encrypt any secret resource inputs/outputs so the snapshot no\n" +
+			"longer depends on the old secrets provider. Pass `--config-only` to make that the explicit choice.\n" +
+			"\n" +
+			"Pass `--dry-run` to see how many config entries (and, with `--include-snapshot`, secret resource\n" +
+			"properties) would be rewritten without changing anything. `--backup` is on by default and leaves a\n" +
+			"`Pulumi.<stack>.yaml.bak`, so the config change can be undone with a single `mv`, and, when rotating\n" +
+			"the snapshot, a timestamped checkpoint export, which is restored with `pulumi stack import`.\n" +
+			"\n" +
+			"To rotate many stacks in one invocation instead of `pulumi stack select`-ing each one in turn, pass\n" +
+			"`--all` (every stack of the current project), `--org <name>` (every stack of the current project in\n" +
+			"an organization), or `--stacks <glob>` (every stack of the current project whose name matches, e.g.\n" +
+			"`--stacks 'prod-*'`). Discovery is always scoped to the current project, since rotation reads and\n" +
+			"writes each stack's `Pulumi.<stack>.yaml` from this directory. Each matching stack is rotated\n" +
+			"independently; a failure on one stack is recorded in a per-stack summary rather than aborting the\n" +
+			"run. Use `--parallel N` to rotate up to N stacks concurrently.\n" +
+			"\n" +
+			"Other secrets providers can be supported without changes to this repo by installing a\n" +
+			"`pulumi-secrets-<scheme>` plugin binary on PATH or in the plugin cache; any scheme such a plugin\n" +
+			"claims, e.g. `--secrets-provider=\"doppler://workplace/config\"`, is accepted alongside the built-ins.\n" +
+			"\n" +
+			"If `--secrets-provider` is omitted and stdin is a terminal, you'll be prompted to choose a provider\n" +
+			"and its parameters interactively, the same as `pulumi new` and `pulumi stack init`. In a non-TTY\n" +
+			"context (e.g. CI), `--secrets-provider` remains required.",
 		Run: cmdutil.RunFunc(func(cmd *cobra.Command, args []string) error {
 			opts := display.Options{
 				Color: cmdutil.GetGlobalColorization(),
 			}
 
 			if secretsProvider == "" {
-				return errors.New("--secrets-provider is required and must be one of " +
-					"`default`, `passphrase`, `awskms`, `azurekeyvault`, `gcpkms`, `hashivault`")
+				if !cmdutil.Interactive() {
+					return errors.New("--secrets-provider is required and must be one of " +
+						"`default`, `passphrase`, `awskms`, `azurekeyvault`, `gcpkms`, `hashivault`, " +
+						"or any scheme claimed by an installed `pulumi-secrets-<scheme>` plugin")
+				}
+				sp, err := promptForSecretsProvider()
+				if err != nil {
+					return err
+				}
+				secretsProvider = sp
+			}
+
+			if includeSnapshot && configOnly {
+				return errors.New("--include-snapshot and --config-only are mutually exclusive")
 			}
+			rotateSnapshot := includeSnapshot && !configOnly
 
 			// Validate secrets provider type
 			if err := validateSecretsProvider(secretsProvider); err != nil {
@@ -68,71 +130,614 @@ func changeSecretsProviderCmd() *cobra.Command {
 				return err
 			}
 
+			ctx := context.Background()
+			fleet := all || org != "" || stacksGlob != ""
+
+			if fleet {
+				stacks, err := listMatchingStacks(ctx, b, all, org, stacksGlob)
+				if err != nil {
+					return err
+				}
+				if len(stacks) == 0 {
+					return errors.New("no stacks matched --all/--org/--stacks")
+				}
+				return rotateStacksSecretsProvider(ctx, b, stacks, secretsProvider, rotateSnapshot, dryRun, backup, parallel)
+			}
+
 			// Get the current stack and it's project
 			// Get current stack and ensure that it is a different stack to the destination stack
 			currentStack, err := requireStack("", false, opts, true /*setCurrent*/)
 			if err != nil {
 				return err
 			}
-			currentProjectStack, err := loadProjectStack(currentStack)
+
+			report, err := rotateOneStack(ctx, b, currentStack, secretsProvider, rotateSnapshot, dryRun, backup)
 			if err != nil {
 				return err
 			}
+			if report != nil {
+				fmt.Println(report)
+			}
+			return nil
+		}),
+	}
 
-			// Build encrypter and decrypter
-			var decrypter config.Decrypter
-			currentConfig := currentProjectStack.Config
+	cmd.PersistentFlags().StringVar(
+		&secretsProvider, "secrets-provider", "", possibleSecretsProviderChoices)
+	cmd.PersistentFlags().BoolVar(
+		&includeSnapshot, "include-snapshot", false,
+		"Also re-encrypt secret resource inputs/outputs in the stack's checkpoint")
+	cmd.PersistentFlags().BoolVar(
+		&configOnly, "config-only", false,
+		"Only re-encrypt the stack's config, leaving the checkpoint untouched (default)")
+	cmd.PersistentFlags().BoolVar(
+		&dryRun, "dry-run", false,
+		"Report how many config entries (and secret properties) would be re-encrypted, without changing anything")
+	cmd.PersistentFlags().BoolVar(
+		&backup, "backup", true,
+		"Write a Pulumi.<stack>.yaml.bak, and a timestamped checkpoint export when rotating the snapshot, before mutating anything")
+	cmd.PersistentFlags().BoolVar(
+		&all, "all", false,
+		"Rotate every stack of the current project instead of just the current stack")
+	cmd.PersistentFlags().StringVar(
+		&org, "org", "",
+		"Rotate every stack of the current project in the given organization instead of just the current stack")
+	cmd.PersistentFlags().StringVar(
+		&stacksGlob, "stacks", "",
+		"Rotate every stack of the current project whose name matches this glob instead of just the current stack")
+	cmd.PersistentFlags().IntVar(
+		&parallel, "parallel", 1,
+		"Rotate up to this many stacks concurrently when using --all, --org, or --stacks")
+	return cmd
+}
 
-			if currentConfig.HasSecureValue() {
-				dec, decerr := getStackDecrypter(currentStack)
-				if decerr != nil {
-					return decerr
-				}
-				decrypter = dec
-			} else {
-				decrypter = config.NewPanicCrypter()
-			}
+// rotateOneStack performs a single stack's secrets provider rotation: building the old decrypter,
+// building the new secrets manager and re-encrypting config (and, if requested, the checkpoint) fully in
+// memory, and only then persisting the result. It's shared by the single-stack path and the
+// --all/--org/--stacks fleet path so both go through exactly the same rotation logic.
+//
+// Nothing is written to Pulumi.<stack>.yaml or the backend until every step that can fail - building the
+// new manager, re-encrypting config, re-encrypting the checkpoint - has already succeeded, so a failure
+// partway through never leaves the stack's secrets provider in a state where the on-disk ciphertext
+// doesn't match what Pulumi.<stack>.yaml says decrypts it. This holds regardless of --backup: --backup
+// only controls whether a Pulumi.<stack>.yaml.bak and a checkpoint export are left behind for manual
+// recovery, it's not load-bearing for correctness.
+//
+// When dryRun is true, rotateOneStack changes nothing and returns a non-nil *dryRunReport describing what
+// would have happened; it never prints anything itself; callers decide how to attribute and display a
+// report - directly for the single-stack path, or attached to a stackRotationResult for the fleet path,
+// where multiple goroutines would otherwise interleave unattributed output.
+func rotateOneStack(
+	ctx context.Context, b backend.Backend, s backend.Stack,
+	secretsProvider string, rotateSnapshot, dryRun, backup bool) (*dryRunReport, error) {
 
-			// Create the new secrets provider and set to the currentStack
-			if err := createSecretsManager(b, currentStack.Ref(), secretsProvider); err != nil {
-				return err
-			}
+	currentProjectStack, err := loadProjectStack(s)
+	if err != nil {
+		return nil, err
+	}
 
-			// Get the new encrypter for the current stack
-			newEncrypter, cerr := getStackEncrypter(currentStack)
-			if cerr != nil {
-				return cerr
-			}
+	// Build encrypter and decrypter. A real decrypter is needed whenever the config has a secure value
+	// to re-encrypt, but also whenever the snapshot is being rotated: secret resource inputs/outputs in
+	// the checkpoint are completely independent of the config map, so a stack with no secure config
+	// entries can still hit a real secret there and panic on config.NewPanicCrypter.
+	var decrypter config.Decrypter
+	currentConfig := currentProjectStack.Config
 
-			// Create a copy of the current config map and re-encrypt using the new secrets provider
-			newProjectConfig, err := currentConfig.Copy(decrypter, newEncrypter)
-			if err != nil {
-				return err
-			}
+	if currentConfig.HasSecureValue() || rotateSnapshot {
+		dec, decerr := getStackDecrypter(s)
+		if decerr != nil {
+			return nil, decerr
+		}
+		decrypter = dec
+	} else {
+		decrypter = config.NewPanicCrypter()
+	}
 
-			// Reload the project stack after the new secretsProvider is in place
-			reloadedProjectStack, err := loadProjectStack(currentStack)
-			if err != nil {
-				return err
-			}
+	if dryRun {
+		report, err := runChangeSecretsProviderDryRun(
+			ctx, b, s, currentProjectStack, decrypter, secretsProvider, rotateSnapshot)
+		if err != nil {
+			return nil, err
+		}
+		return &report, nil
+	}
 
-			for key, val := range newProjectConfig {
-				err = reloadedProjectStack.Config.Set(key, val, false)
-				if err != nil {
-					return err
-				}
+	// Build the new secrets manager and an in-memory description of what Pulumi.<stack>.yaml would
+	// become; nothing is saved yet.
+	newManager, newProjectStack, err := buildSecretsManagerState(b, s, currentProjectStack, secretsProvider)
+	if err != nil {
+		return nil, err
+	}
+	newEncrypter := newManager.Encrypter()
+
+	// Re-encrypt the current config map using the new secrets provider, still entirely in memory.
+	newProjectConfig, err := currentConfig.Copy(decrypter, newEncrypter)
+	if err != nil {
+		return nil, errors.Wrap(err, "re-encrypting stack config")
+	}
+	for key, val := range newProjectConfig {
+		if err := newProjectStack.Config.Set(key, val, false); err != nil {
+			return nil, err
+		}
+	}
+
+	// If requested, also re-encrypt every secret resource input/output in the stack's checkpoint, again
+	// without touching the backend yet. originalDeployment is kept so a failure persisting afterwards
+	// can put the checkpoint back the way it was.
+	var originalDeployment, newDeployment *apitype.UntypedDeployment
+	if rotateSnapshot {
+		orig, rewritten, _, derr := reencryptSnapshotSecretsCounted(ctx, b, s, decrypter, newEncrypter)
+		if derr != nil {
+			return nil, errors.Wrap(derr, "re-encrypting stack snapshot")
+		}
+		originalDeployment, newDeployment = orig, rewritten
+	}
+
+	// Everything above only ever read from the backend; from here on we're persisting. Take the
+	// (optional, best-effort) manual-recovery backups first, then commit the checkpoint - a network
+	// call to the backend, and so the likelier of the two remaining steps to fail - before the local
+	// Pulumi.<stack>.yaml write, so a failure never leaves the yaml pointing at a provider whose key
+	// the checkpoint wasn't actually rewritten with.
+	if backup {
+		if err := backupProjectStack(s); err != nil {
+			return nil, errors.Wrap(err, "backing up Pulumi.<stack>.yaml")
+		}
+		if rotateSnapshot {
+			if err := backupCheckpoint(ctx, b, s); err != nil {
+				return nil, errors.Wrap(err, "backing up stack checkpoint")
 			}
+		}
+	}
+
+	if rotateSnapshot {
+		if err := b.ImportDeployment(ctx, s, newDeployment); err != nil {
+			return nil, errors.Wrap(err, "importing re-encrypted stack snapshot")
+		}
+	}
+
+	if err := saveProjectStack(s, newProjectStack); err != nil {
+		if rotateSnapshot {
+			return nil, rollbackSnapshotImport(ctx, b, s, originalDeployment, err)
+		}
+		return nil, errors.Wrap(err, "saving Pulumi.<stack>.yaml")
+	}
+
+	return nil, nil
+}
+
+// listMatchingStacks discovers every stack known to b that matches the --all/--org/--stacks selection,
+// via the backend's ListStacks. Discovery is always scoped to the current project: rotation reads
+// and writes each matched stack's Pulumi.<stack>.yaml from the invoking directory, via
+// workspace.DetectProjectStackPath, so a stack belonging to a different project either has no local
+// config file to rotate or, worse, shares a name with one that does and isn't actually the stack it
+// looks like.
+func listMatchingStacks(ctx context.Context, b backend.Backend, all bool, org, stacksGlob string) ([]backend.Stack, error) {
+	proj, err := workspace.DetectProject()
+	if err != nil {
+		return nil, errors.Wrap(err, "detecting current project")
+	}
+	projectName := proj.Name.String()
 
-			err = saveProjectStack(currentStack, reloadedProjectStack)
+	var filter backend.ListStacksFilter
+	filter.Project = &projectName
+	if org != "" {
+		filter.Organization = &org
+	}
+
+	summaries, err := b.ListStacks(ctx, filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing stacks")
+	}
+
+	var stacks []backend.Stack
+	for _, summary := range summaries {
+		name := summary.Name().String()
+		if stacksGlob != "" {
+			matched, err := path.Match(stacksGlob, name)
 			if err != nil {
-				return err
+				return nil, errors.Wrapf(err, "invalid --stacks glob %q", stacksGlob)
+			}
+			if !matched {
+				continue
 			}
+		} else if !all && org == "" {
+			continue
+		}
 
-			return nil
-		}),
+		ref, err := b.ParseStackReference(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing stack reference %q", name)
+		}
+		s, err := b.GetStack(ctx, ref)
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading stack %q", name)
+		}
+		stacks = append(stacks, s)
 	}
+	return stacks, nil
+}
 
-	cmd.PersistentFlags().StringVar(
-		&secretsProvider, "secrets-provider", "", possibleSecretsProviderChoices)
-	return cmd
+// rotateStacksSecretsProvider rotates the secrets provider for every stack in stacks, running up to
+// parallel rotations concurrently so KMS round-trips for large fleets don't serialize. Per-stack
+// failures don't abort the run; they're collected and reported in a summary once every stack has been
+// attempted.
+func rotateStacksSecretsProvider(
+	ctx context.Context, b backend.Backend, stacks []backend.Stack,
+	secretsProvider string, rotateSnapshot, dryRun, backup bool, parallel int) error {
+
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]stackRotationResult, len(stacks))
+
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, s := range stacks {
+		i, s := i, s
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			report, err := rotateOneStack(ctx, b, s, secretsProvider, rotateSnapshot, dryRun, backup)
+			results[i] = stackRotationResult{Name: s.Ref().String(), Err: err, DryRun: report}
+		}()
+	}
+	wg.Wait()
+
+	summary, failed := summarizeRotationResults(results, dryRun)
+	fmt.Print(summary)
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d stacks failed to rotate; see per-stack errors above", failed, len(stacks))
+	}
+	return nil
+}
+
+// stackRotationResult is one stack's outcome from rotateStacksSecretsProvider: Err is nil on success.
+// DryRun is only set for a --dry-run invocation whose dry run succeeded, in which case Err is nil; a dry
+// run that hits an error reports it in Err, the same as a real rotation would, and leaves DryRun nil.
+type stackRotationResult struct {
+	Name   string
+	Err    error
+	DryRun *dryRunReport
+}
+
+// summarizeRotationResults renders a per-stack line plus a totals line for a completed fleet rotation (or,
+// when dryRun is true, a completed fleet dry run), and returns how many stacks failed. It's pure so the
+// worker-pool and rollback logic in rotateStacksSecretsProvider don't need to be exercised just to test
+// the summary it prints.
+func summarizeRotationResults(results []stackRotationResult, dryRun bool) (summary string, failed int) {
+	var b strings.Builder
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Fprintf(&b, "%s: FAILED: %v\n", r.Name, r.Err)
+		case r.DryRun != nil:
+			fmt.Fprintf(&b, "%s: %s\n", r.Name, r.DryRun)
+		default:
+			fmt.Fprintf(&b, "%s: ok\n", r.Name)
+		}
+	}
+	if dryRun {
+		fmt.Fprintf(&b, "\nwould rotate %d/%d stacks (%d failed)\n", len(results)-failed, len(results), failed)
+	} else {
+		fmt.Fprintf(&b, "\nrotated %d/%d stacks (%d failed)\n", len(results)-failed, len(results), failed)
+	}
+	return b.String(), failed
+}
+
+// dryRunReport is what a --dry-run invocation found for one stack: how many config entries (and, when
+// rotateSnapshot was requested, secret resource properties in the checkpoint) would be re-encrypted. It's
+// returned rather than printed directly so a fleet rotation can attribute it to the right stack instead of
+// letting concurrent goroutines interleave unattributed Printf output.
+type dryRunReport struct {
+	SecretsProvider    string
+	ConfigEntries      int
+	RotateSnapshot     bool
+	SnapshotProperties int
+}
+
+// String renders report the way it's surfaced to the user, whether that's directly under the
+// single-stack path or as one line of summarizeRotationResults' fleet summary.
+func (r dryRunReport) String() string {
+	s := fmt.Sprintf("would re-encrypt %d config entr%s with %q",
+		r.ConfigEntries, pluralizeIes(r.ConfigEntries), r.SecretsProvider)
+	if r.RotateSnapshot {
+		s += fmt.Sprintf("; would re-encrypt %d secret propert%s in the stack snapshot",
+			r.SnapshotProperties, pluralizeIes(r.SnapshotProperties))
+	}
+	return s
+}
+
+// runChangeSecretsProviderDryRun performs the same decrypt/re-encrypt round-trip as a real rotation,
+// building the new secrets manager via the same buildSecretsManagerState call a real rotation uses -
+// including its "default" on a Pulumi Service backend special case - so dry run reports against the
+// provider that would actually be used, not always a local passphrase-backed one. It never touches disk
+// or the backend: no saveProjectStack, and (when rotating the snapshot) no ImportDeployment. It never
+// prints anything itself; see dryRunReport.
+func runChangeSecretsProviderDryRun(
+	ctx context.Context, b backend.Backend, s backend.Stack, ps *workspace.ProjectStack, decrypter config.Decrypter,
+	secretsProvider string, rotateSnapshot bool) (dryRunReport, error) {
+
+	sm, _, err := buildSecretsManagerState(b, s, ps, secretsProvider)
+	if err != nil {
+		return dryRunReport{}, errors.Wrap(err, "constructing secrets provider for dry run")
+	}
+
+	newProjectConfig, err := ps.Config.Copy(decrypter, sm.Encrypter())
+	if err != nil {
+		return dryRunReport{}, err
+	}
+	configEntries := 0
+	for _, v := range newProjectConfig {
+		if v.Secure() {
+			configEntries++
+		}
+	}
+	report := dryRunReport{
+		SecretsProvider: secretsProvider,
+		ConfigEntries:   configEntries,
+		RotateSnapshot:  rotateSnapshot,
+	}
+
+	if rotateSnapshot {
+		_, _, rewritten, err := reencryptSnapshotSecretsCounted(ctx, b, s, decrypter, sm.Encrypter())
+		if err != nil {
+			return dryRunReport{}, errors.Wrap(err, "dry-running stack snapshot re-encryption")
+		}
+		report.SnapshotProperties = rewritten
+	}
+
+	return report, nil
+}
+
+func pluralizeIes(n int) string {
+	if n == 1 {
+		return "y"
+	}
+	return "ies"
+}
+
+// promptForSecretsProvider interactively builds a `--secrets-provider` value, mirroring the survey-style
+// prompts `pulumi new` and `pulumi stack init` use elsewhere: a select for the provider kind, followed by
+// whatever parameters that kind needs to assemble its URL. Only called when stdin is a TTY.
+func promptForSecretsProvider() (string, error) {
+	const (
+		optDefault       = "default (the Pulumi Service manages encryption for you)"
+		optPassphrase    = "passphrase"
+		optAWSKMS        = "awskms"
+		optAzureKeyVault = "azurekeyvault"
+		optGCPKMS        = "gcpkms"
+		optHashiVault    = "hashivault"
+	)
+
+	kind := ""
+	if err := survey.AskOne(&survey.Select{
+		Message: "Select a secrets provider",
+		Options: []string{optDefault, optPassphrase, optAWSKMS, optAzureKeyVault, optGCPKMS, optHashiVault},
+		Default: optDefault,
+	}, &kind, surveyIcons(cmdutil.GetGlobalColorization())); err != nil {
+		return "", errors.Wrap(err, "selecting a secrets provider")
+	}
+
+	switch kind {
+	case optDefault:
+		return "default", nil
+	case optPassphrase:
+		return promptForPassphraseProvider()
+	case optAWSKMS:
+		return promptForAWSKMSProvider()
+	case optAzureKeyVault:
+		return promptForAzureKeyVaultProvider()
+	case optGCPKMS:
+		return promptForGCPKMSProvider()
+	case optHashiVault:
+		return promptForHashiVaultProvider()
+	default:
+		return "", errors.Errorf("unknown secrets provider %q", kind)
+	}
+}
+
+// promptForPassphraseProvider asks for (and confirms) a passphrase, exports it as
+// PULUMI_CONFIG_PASSPHRASE for the rest of this invocation to pick up, and returns "passphrase".
+func promptForPassphraseProvider() (string, error) {
+	phrase := ""
+	if err := survey.AskOne(&survey.Password{Message: "Passphrase"},
+		&phrase, survey.WithValidator(survey.Required)); err != nil {
+		return "", errors.Wrap(err, "reading passphrase")
+	}
+
+	confirm := ""
+	if err := survey.AskOne(&survey.Password{Message: "Re-enter passphrase to confirm"},
+		&confirm, survey.WithValidator(survey.Required)); err != nil {
+		return "", errors.Wrap(err, "reading passphrase confirmation")
+	}
+
+	if phrase != confirm {
+		return "", errors.New("passphrases do not match")
+	}
+
+	if err := os.Setenv("PULUMI_CONFIG_PASSPHRASE", phrase); err != nil {
+		return "", errors.Wrap(err, "setting PULUMI_CONFIG_PASSPHRASE")
+	}
+	return "passphrase", nil
+}
+
+func promptForAWSKMSProvider() (string, error) {
+	key, err := promptRequiredInput("KMS key ARN or alias (e.g. alias/ExampleAlias)")
+	if err != nil {
+		return "", err
+	}
+	region, err := promptRequiredInput("AWS region (e.g. us-east-1)")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("awskms://%s?region=%s", key, region), nil
+}
+
+func promptForAzureKeyVaultProvider() (string, error) {
+	key, err := promptRequiredInput("Key Vault key (e.g. mykeyvaultname.vault.azure.net/keys/mykeyname)")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("azurekeyvault://%s", key), nil
+}
+
+func promptForGCPKMSProvider() (string, error) {
+	key, err := promptRequiredInput(
+		"KMS CryptoKey resource name (e.g. projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>)")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("gcpkms://%s", key), nil
+}
+
+func promptForHashiVaultProvider() (string, error) {
+	key, err := promptRequiredInput("Vault transit key name")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("hashivault://%s", key), nil
+}
+
+// promptRequiredInput asks a single free-text question and rejects an empty answer.
+func promptRequiredInput(message string) (string, error) {
+	answer := ""
+	if err := survey.AskOne(&survey.Input{Message: message},
+		&answer, survey.WithValidator(survey.Required)); err != nil {
+		return "", errors.Wrapf(err, "reading %q", message)
+	}
+	return answer, nil
+}
+
+// backupProjectStack copies the stack's Pulumi.<stack>.yaml to Pulumi.<stack>.yaml.bak so a rotation
+// can be undone with `mv Pulumi.<stack>.yaml.bak Pulumi.<stack>.yaml`.
+func backupProjectStack(s backend.Stack) error {
+	path, err := workspace.DetectProjectStackPath(s.Ref().Name())
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path+".bak", contents, 0600)
+}
+
+// backupCheckpoint exports the stack's current deployment to a timestamped JSON file in the current
+// working directory, so a snapshot rotation can be rolled back with `pulumi stack import`.
+func backupCheckpoint(ctx context.Context, b backend.Backend, s backend.Stack) error {
+	deployment, err := b.ExportDeployment(ctx, s)
+	if err != nil {
+		return err
+	}
+	bytes, err := json.MarshalIndent(deployment, "", "    ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s.checkpoint.%s.json", s.Ref().Name(), time.Now().UTC().Format("20060102T150405Z"))
+	return ioutil.WriteFile(name, bytes, 0600)
+}
+
+// rollbackSnapshotImport is called when saveProjectStack fails after the re-encrypted checkpoint has
+// already been imported into the backend - the one step of rotateOneStack's persistence that can leave
+// the backend and Pulumi.<stack>.yaml disagreeing about which provider's key the checkpoint is under. It
+// re-imports the pre-rotation deployment to put the backend back the way it was, then surfaces the
+// original save error (or a worse one, if the re-import itself fails).
+func rollbackSnapshotImport(
+	ctx context.Context, b backend.Backend, s backend.Stack, original *apitype.UntypedDeployment, cause error,
+) error {
+	if err := b.ImportDeployment(ctx, s, original); err != nil {
+		return errors.Wrapf(cause, "saving Pulumi.<stack>.yaml failed, "+
+			"and restoring the pre-rotation checkpoint also failed: %v", err)
+	}
+	return errors.Wrap(cause, "saving Pulumi.<stack>.yaml failed; restored the pre-rotation checkpoint")
+}
+
+// reencryptSnapshotSecretsCounted exports the current deployment for s, decrypts every secret-typed
+// resource input and output using oldDecrypter, re-encrypts them using newEncrypter, and returns both the
+// original (untouched) deployment and the rewritten one, along with the number of secret properties that
+// were re-encrypted (for --dry-run reporting). It does not import anything back into the backend:
+// callers should only do so once they're sure the rest of the rotation has succeeded, and may use the
+// original deployment to undo that import if a later step fails.
+func reencryptSnapshotSecretsCounted(
+	ctx context.Context, b backend.Backend, s backend.Stack,
+	oldDecrypter config.Decrypter, newEncrypter config.Encrypter,
+) (original, rewrittenDeployment *apitype.UntypedDeployment, rewrittenCount int, err error) {
+
+	original, err = b.ExportDeployment(ctx, s)
+	if err != nil {
+		return nil, nil, 0, errors.Wrap(err, "exporting stack deployment")
+	}
+
+	var snapshot apitype.DeploymentV3
+	if err := json.Unmarshal(original.Deployment, &snapshot); err != nil {
+		return nil, nil, 0, errors.Wrap(err, "unmarshalling deployment")
+	}
+
+	var rewritten int
+	for i, res := range snapshot.Resources {
+		inputs, err := stack.DeserializeProperties(res.Inputs, oldDecrypter)
+		if err != nil {
+			return nil, nil, 0, errors.Wrapf(err, "decrypting inputs for resource %s", res.URN)
+		}
+		outputs, err := stack.DeserializeProperties(res.Outputs, oldDecrypter)
+		if err != nil {
+			return nil, nil, 0, errors.Wrapf(err, "decrypting outputs for resource %s", res.URN)
+		}
+		rewritten += countSecretProperties(inputs) + countSecretProperties(outputs)
+
+		newInputs, err := stack.SerializeProperties(inputs, newEncrypter, false /*showSecrets*/)
+		if err != nil {
+			return nil, nil, 0, errors.Wrapf(err, "re-encrypting inputs for resource %s", res.URN)
+		}
+		newOutputs, err := stack.SerializeProperties(outputs, newEncrypter, false /*showSecrets*/)
+		if err != nil {
+			return nil, nil, 0, errors.Wrapf(err, "re-encrypting outputs for resource %s", res.URN)
+		}
+
+		res.Inputs = newInputs
+		res.Outputs = newOutputs
+		snapshot.Resources[i] = res
+	}
+
+	rewrittenJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, nil, 0, errors.Wrap(err, "marshalling re-encrypted deployment")
+	}
+
+	return original, &apitype.UntypedDeployment{
+		Version:    original.Version,
+		Deployment: json.RawMessage(rewrittenJSON),
+	}, rewritten, nil
+}
+
+// countSecretProperties returns the number of secret-typed values in props, walking into nested
+// objects and arrays.
+func countSecretProperties(props resource.PropertyMap) int {
+	var count int
+	for _, v := range props {
+		count += countSecretPropertyValue(v)
+	}
+	return count
+}
+
+func countSecretPropertyValue(v resource.PropertyValue) int {
+	switch {
+	case v.IsSecret():
+		return 1 + countSecretPropertyValue(v.SecretValue().Element)
+	case v.IsObject():
+		return countSecretProperties(v.ObjectValue())
+	case v.IsArray():
+		var count int
+		for _, elem := range v.ArrayValue() {
+			count += countSecretPropertyValue(elem)
+		}
+		return count
+	default:
+		return 0
+	}
 }
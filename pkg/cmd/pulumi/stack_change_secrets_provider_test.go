@@ -0,0 +1,115 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/workspace"
+)
+
+func TestSummarizeRotationResultsAllSucceed(t *testing.T) {
+	summary, failed := summarizeRotationResults([]stackRotationResult{
+		{Name: "dev", Err: nil},
+		{Name: "prod", Err: nil},
+	}, false)
+
+	assert.Equal(t, 0, failed)
+	assert.Contains(t, summary, "dev: ok")
+	assert.Contains(t, summary, "prod: ok")
+	assert.Contains(t, summary, "rotated 2/2 stacks (0 failed)")
+}
+
+func TestSummarizeRotationResultsSomeFail(t *testing.T) {
+	summary, failed := summarizeRotationResults([]stackRotationResult{
+		{Name: "dev", Err: nil},
+		{Name: "prod", Err: errors.New("kms unavailable")},
+	}, false)
+
+	assert.Equal(t, 1, failed)
+	assert.Contains(t, summary, "dev: ok")
+	assert.Contains(t, summary, "prod: FAILED: kms unavailable")
+	assert.Contains(t, summary, "rotated 1/2 stacks (1 failed)")
+}
+
+func TestSummarizeRotationResultsEmpty(t *testing.T) {
+	summary, failed := summarizeRotationResults(nil, false)
+
+	assert.Equal(t, 0, failed)
+	assert.Contains(t, summary, "rotated 0/0 stacks (0 failed)")
+}
+
+// TestSummarizeRotationResultsDryRunPerStack guards the fleet --dry-run bug: each stack's dry-run
+// counts must be attributed to that stack's own line in the summary, not printed unsynchronized from
+// worker goroutines where concurrent output would interleave and lose its attribution entirely.
+func TestSummarizeRotationResultsDryRunPerStack(t *testing.T) {
+	summary, failed := summarizeRotationResults([]stackRotationResult{
+		{Name: "dev", DryRun: &dryRunReport{SecretsProvider: "passphrase", ConfigEntries: 3}},
+		{
+			Name: "prod",
+			DryRun: &dryRunReport{
+				SecretsProvider: "awskms://alias/Foo", ConfigEntries: 5,
+				RotateSnapshot: true, SnapshotProperties: 2,
+			},
+		},
+		{Name: "staging", Err: errors.New("kms unavailable")},
+	}, true)
+
+	assert.Equal(t, 1, failed)
+	assert.Contains(t, summary, `dev: would re-encrypt 3 config entries with "passphrase"`)
+	assert.Contains(t, summary,
+		`prod: would re-encrypt 5 config entries with "awskms://alias/Foo"; `+
+			"would re-encrypt 2 secret properties in the stack snapshot")
+	assert.Contains(t, summary, "staging: FAILED: kms unavailable")
+	assert.Contains(t, summary, "would rotate 2/3 stacks (1 failed)")
+}
+
+// TestBuildSecretsManagerStateDoesNotMutateInput guards the bug rotateOneStack used to have: the old
+// createSecretsManager mutated and saved Pulumi.<stack>.yaml before config or checkpoint re-encryption
+// had even been attempted, so a later failure left the file pointing at a provider the ciphertext on
+// disk didn't match. buildSecretsManagerState must describe the new provider in a copy, leaving the
+// caller's ProjectStack - still the on-disk truth until the rest of the rotation has succeeded -
+// completely untouched.
+func TestBuildSecretsManagerStateDoesNotMutateInput(t *testing.T) {
+	require.NoError(t, os.Setenv("PULUMI_CONFIG_PASSPHRASE", "correct-horse-battery-staple"))
+	defer os.Unsetenv("PULUMI_CONFIG_PASSPHRASE")
+
+	ps := &workspace.ProjectStack{
+		SecretsProvider: "awskms://alias/Old?region=us-east-1",
+		EncryptionSalt:  "old-salt",
+		EncryptedKey:    "old-key",
+		EncryptionMode:  "envelope",
+	}
+
+	// Neither b nor s is ever dereferenced for a non-"default" provider: the "default" special case is
+	// the only thing that touches either.
+	_, newPs, err := buildSecretsManagerState(nil, nil, ps, "passphrase")
+	require.NoError(t, err)
+
+	assert.Equal(t, "passphrase", newPs.SecretsProvider)
+	assert.NotEmpty(t, newPs.SecretsProviderState)
+	assert.Empty(t, newPs.EncryptionSalt)
+	assert.Empty(t, newPs.EncryptedKey)
+	assert.Equal(t, "envelope", newPs.EncryptionMode)
+
+	assert.Equal(t, "awskms://alias/Old?region=us-east-1", ps.SecretsProvider)
+	assert.Equal(t, "old-salt", ps.EncryptionSalt)
+	assert.Equal(t, "old-key", ps.EncryptedKey)
+}
@@ -0,0 +1,38 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	gocloudsecrets "gocloud.dev/secrets"
+	_ "gocloud.dev/secrets/azurekeyvault" // registers the azurekeyvault:// URL scheme with gocloud.dev/secrets
+)
+
+func init() {
+	RegisterBuiltin("azurekeyvault", newAzureKeyVaultManager)
+}
+
+// newAzureKeyVaultManager builds a Manager backed by an Azure Key Vault key, e.g.
+// "azurekeyvault://mykeyvaultname.vault.azure.net/keys/mykeyname".
+func newAzureKeyVaultManager(secretsProviderURL string, mode EncryptionMode, state json.RawMessage) (Manager, error) {
+	keeper, err := gocloudsecrets.OpenKeeper(context.Background(), secretsProviderURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening Azure Key Vault key %q", secretsProviderURL)
+	}
+	return newCloudManager("azurekeyvault", &gocloudCMKCrypter{keeper: keeper}, mode, state)
+}
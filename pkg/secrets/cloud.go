@@ -0,0 +1,154 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	gocloudsecrets "gocloud.dev/secrets"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource/config"
+)
+
+// cmkCrypter wraps and unwraps a short byte string (either a config value, in direct mode, or a data
+// encryption key, in envelope mode) with a cloud KMS customer master key (CMK). Each cloud-backed
+// provider (awskms, azurekeyvault, gcpkms, hashivault) supplies one; all four use gocloudCMKCrypter.
+type cmkCrypter interface {
+	WrapKey(plaintext []byte) (wrapped []byte, err error)
+	UnwrapKey(wrapped []byte) (plaintext []byte, err error)
+}
+
+// gocloudCMKCrypter adapts a gocloud.dev/secrets.Keeper - which all four of our cloud providers open
+// their CMK through - to cmkCrypter.
+type gocloudCMKCrypter struct {
+	keeper *gocloudsecrets.Keeper
+}
+
+func (c *gocloudCMKCrypter) WrapKey(plaintext []byte) ([]byte, error) {
+	return c.keeper.Encrypt(context.Background(), plaintext)
+}
+
+func (c *gocloudCMKCrypter) UnwrapKey(wrapped []byte) ([]byte, error) {
+	return c.keeper.Decrypt(context.Background(), wrapped)
+}
+
+// cloudManager is the Manager shared by every cloud-backed provider. In EncryptionModeDirect it
+// round-trips every value through the CMK, exactly as these providers have always behaved. In
+// EncryptionModeEnvelope it instead encrypts values locally under a per-stack data encryption key (DEK),
+// and only unwraps/wraps that single DEK with the CMK - the behavior `change-secrets-provider` rotation
+// needs to stay fast for stacks with hundreds of secrets.
+type cloudManager struct {
+	scheme     string
+	cmk        cmkCrypter
+	mode       EncryptionMode
+	dek        []byte // non-nil only when mode == EncryptionModeEnvelope
+	wrappedDEK []byte
+}
+
+// cloudProviderState is the envelope-mode provider state persisted in Pulumi.<stack>.yaml; in direct
+// mode there's nothing to persist beyond the `--secrets-provider` URL itself.
+type cloudProviderState struct {
+	WrappedDEK string `json:"wrappeddek"`
+}
+
+// newCloudManager builds the Manager for a cloud-backed scheme. In EncryptionModeDirect, state is
+// ignored. In EncryptionModeEnvelope, a nil/empty state mints a fresh DEK (the stack's first rotation
+// into envelope mode, or a brand new stack); a non-nil state unwraps the DEK it contains instead,
+// so the manager can decrypt values that were encrypted by an earlier invocation.
+func newCloudManager(scheme string, cmk cmkCrypter, mode EncryptionMode, state json.RawMessage) (Manager, error) {
+	if mode != EncryptionModeEnvelope {
+		return &cloudManager{scheme: scheme, cmk: cmk, mode: mode}, nil
+	}
+
+	if len(state) == 0 {
+		dek, err := generateDEK()
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := cmk.WrapKey(dek)
+		if err != nil {
+			return nil, errors.Wrap(err, "wrapping data encryption key")
+		}
+		return &cloudManager{scheme: scheme, cmk: cmk, mode: mode, dek: dek, wrappedDEK: wrapped}, nil
+	}
+
+	var s cloudProviderState
+	if err := json.Unmarshal(state, &s); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling cloud secrets provider state")
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(s.WrappedDEK)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding wrapped data encryption key")
+	}
+	dek, err := cmk.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, errors.Wrap(err, "unwrapping data encryption key")
+	}
+	return &cloudManager{scheme: scheme, cmk: cmk, mode: mode, dek: dek, wrappedDEK: wrapped}, nil
+}
+
+func (m *cloudManager) Type() string { return m.scheme }
+
+func (m *cloudManager) State() json.RawMessage {
+	if m.mode != EncryptionModeEnvelope {
+		return nil
+	}
+	state, _ := json.Marshal(cloudProviderState{WrappedDEK: base64.StdEncoding.EncodeToString(m.wrappedDEK)})
+	return state
+}
+
+func (m *cloudManager) Encrypter() config.Encrypter { return &cloudCrypter{m: m} }
+func (m *cloudManager) Decrypter() config.Decrypter { return &cloudCrypter{m: m} }
+
+// cloudCrypter implements config.Encrypter/config.Decrypter for a cloudManager. Encrypting always uses
+// the manager's current mode; decrypting auto-detects the format from the ciphertext's prefix, so a
+// stack moving to `encryptionmode: envelope` doesn't invalidate values written before the switch.
+type cloudCrypter struct {
+	m *cloudManager
+}
+
+func (c *cloudCrypter) EncryptValue(plaintext string) (string, error) {
+	if c.m.mode == EncryptionModeEnvelope {
+		return encryptEnvelope(c.m.dek, plaintext)
+	}
+	wrapped, err := c.m.cmk.WrapKey([]byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+func (c *cloudCrypter) DecryptValue(ciphertext string) (string, error) {
+	if isEnvelopeCiphertext(ciphertext) {
+		if c.m.dek == nil {
+			return "", errors.New("value is envelope-encrypted but no data encryption key is available; " +
+				"is this stack's Pulumi.<stack>.yaml missing its wrapped key?")
+		}
+		return decryptEnvelope(c.m.dek, ciphertext)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", errors.Wrap(err, "decoding ciphertext")
+	}
+	plaintext, err := c.m.cmk.UnwrapKey(raw)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCMKCrypter stands in for a cloud KMS CMK without making any network calls: it "wraps" a key by
+// reversing its bytes, which is reversible (so UnwrapKey can recover it) but distinguishable from the
+// plaintext, which is all these tests need from a cmkCrypter.
+type fakeCMKCrypter struct {
+	wrapCalls, unwrapCalls int
+}
+
+func (c *fakeCMKCrypter) WrapKey(plaintext []byte) ([]byte, error) {
+	c.wrapCalls++
+	return reverseBytes(plaintext), nil
+}
+
+func (c *fakeCMKCrypter) UnwrapKey(wrapped []byte) ([]byte, error) {
+	c.unwrapCalls++
+	return reverseBytes(wrapped), nil
+}
+
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, v := range b {
+		out[len(b)-1-i] = v
+	}
+	return out
+}
+
+func TestNewCloudManagerDirectModeIgnoresState(t *testing.T) {
+	cmk := &fakeCMKCrypter{}
+
+	m, err := newCloudManager("awskms", cmk, EncryptionModeDirect, json.RawMessage(`{"wrappeddek":"garbage"}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "awskms", m.Type())
+	assert.Nil(t, m.State())
+	assert.Equal(t, 0, cmk.wrapCalls)
+	assert.Equal(t, 0, cmk.unwrapCalls)
+}
+
+func TestNewCloudManagerEnvelopeModeMintsDEKWhenStateEmpty(t *testing.T) {
+	cmk := &fakeCMKCrypter{}
+
+	m, err := newCloudManager("gcpkms", cmk, EncryptionModeEnvelope, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, cmk.wrapCalls)
+	state := m.State()
+	require.NotNil(t, state)
+
+	var s cloudProviderState
+	require.NoError(t, json.Unmarshal(state, &s))
+	assert.NotEmpty(t, s.WrappedDEK)
+}
+
+func TestNewCloudManagerEnvelopeModeUnwrapsExistingState(t *testing.T) {
+	cmk := &fakeCMKCrypter{}
+
+	dek, err := generateDEK()
+	require.NoError(t, err)
+	wrapped, err := cmk.WrapKey(dek)
+	require.NoError(t, err)
+	state, err := json.Marshal(cloudProviderState{WrappedDEK: base64.StdEncoding.EncodeToString(wrapped)})
+	require.NoError(t, err)
+
+	cmk.wrapCalls = 0 // only the unwrap below should count against this fresh manager
+	m, err := newCloudManager("gcpkms", cmk, EncryptionModeEnvelope, state)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, cmk.unwrapCalls)
+	assert.Equal(t, 0, cmk.wrapCalls)
+	// The reconstructed manager must decrypt a value the original DEK encrypted.
+	ciphertext, err := encryptEnvelope(dek, "hunter2")
+	require.NoError(t, err)
+	plaintext, err := m.Decrypter().DecryptValue(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", plaintext)
+}
+
+func TestNewCloudManagerEnvelopeModeRejectsInvalidState(t *testing.T) {
+	cmk := &fakeCMKCrypter{}
+
+	_, err := newCloudManager("gcpkms", cmk, EncryptionModeEnvelope, json.RawMessage(`not json`))
+	assert.Error(t, err)
+}
+
+func TestCloudCrypterDirectModeRoundTrip(t *testing.T) {
+	cmk := &fakeCMKCrypter{}
+	m, err := newCloudManager("azurekeyvault", cmk, EncryptionModeDirect, nil)
+	require.NoError(t, err)
+
+	ciphertext, err := m.Encrypter().EncryptValue("hunter2")
+	require.NoError(t, err)
+	assert.NotContains(t, ciphertext, "hunter2")
+
+	plaintext, err := m.Decrypter().DecryptValue(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", plaintext)
+}
+
+func TestCloudCrypterEnvelopeModeRoundTrip(t *testing.T) {
+	cmk := &fakeCMKCrypter{}
+	m, err := newCloudManager("hashivault", cmk, EncryptionModeEnvelope, nil)
+	require.NoError(t, err)
+
+	ciphertext, err := m.Encrypter().EncryptValue("hunter2")
+	require.NoError(t, err)
+	assert.True(t, isEnvelopeCiphertext(ciphertext))
+
+	plaintext, err := m.Decrypter().DecryptValue(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", plaintext)
+}
+
+// TestCloudCrypterDecryptAutoDetectsModeFromCiphertextPrefix guards the behavior that lets a stack move
+// to `encryptionmode: envelope` without invalidating config already encrypted directly against the CMK:
+// the decrypter picks its path from the ciphertext's own prefix, not from the manager's current mode.
+func TestCloudCrypterDecryptAutoDetectsModeFromCiphertextPrefix(t *testing.T) {
+	cmk := &fakeCMKCrypter{}
+
+	directManager, err := newCloudManager("awskms", cmk, EncryptionModeDirect, nil)
+	require.NoError(t, err)
+	directCiphertext, err := directManager.Encrypter().EncryptValue("old-direct-value")
+	require.NoError(t, err)
+
+	envelopeManager, err := newCloudManager("awskms", cmk, EncryptionModeEnvelope, nil)
+	require.NoError(t, err)
+
+	// envelopeManager encrypts in envelope mode under its own freshly minted DEK, yet it still decrypts
+	// directManager's value: the value has no envelope prefix, so decryption sends it through the CMK,
+	// dispatching on the ciphertext rather than on the manager's mode.
+	plaintext, err := envelopeManager.Decrypter().DecryptValue(directCiphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "old-direct-value", plaintext)
+}
+
+func TestCloudCrypterDecryptEnvelopeWithoutDEKFails(t *testing.T) {
+	cmk := &fakeCMKCrypter{}
+	directManager, err := newCloudManager("awskms", cmk, EncryptionModeDirect, nil)
+	require.NoError(t, err)
+
+	envelopeManager, err := newCloudManager("awskms", cmk, EncryptionModeEnvelope, nil)
+	require.NoError(t, err)
+	envelopeCiphertext, err := envelopeManager.Encrypter().EncryptValue("hunter2")
+	require.NoError(t, err)
+
+	_, err = directManager.Decrypter().DecryptValue(envelopeCiphertext)
+	assert.Error(t, err)
+}
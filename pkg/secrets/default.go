@@ -0,0 +1,43 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import "encoding/json"
+
+func init() {
+	RegisterBuiltin("default", newDefaultManager)
+}
+
+// newDefaultManager builds the Manager for `--secrets-provider=default` on a DIY backend (local, S3,
+// ...), falling back to the same passphrase-derived encryption as `--secrets-provider=passphrase`. The
+// managed Pulumi Service backend manages a per-stack key for "default" itself and is special-cased
+// before it ever reaches this registry - see buildSecretsManagerState/stackSecretsManager in
+// pkg/cmd/pulumi, which check backend.Backend.SupportsOrganizations() and defer to the stack's own
+// DefaultSecretsManager instead of calling NewManager("default") at all.
+func newDefaultManager(secretsProviderURL string, mode EncryptionMode, state json.RawMessage) (Manager, error) {
+	m, err := newPassphraseManager(secretsProviderURL, mode, state)
+	if err != nil {
+		return nil, err
+	}
+	return &defaultManager{Manager: m}, nil
+}
+
+// defaultManager is a passphraseManager that reports its Type as "default" rather than "passphrase", so
+// a stack rotated onto `default` records the provider the user actually asked for.
+type defaultManager struct {
+	Manager
+}
+
+func (m *defaultManager) Type() string { return "default" }
@@ -0,0 +1,100 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// EncryptionMode selects how a cloud-backed secrets manager encrypts config values. It's read from the
+// `encryptionmode` key in Pulumi.<stack>.yaml so existing stacks keep their current (and default)
+// behavior unless a user opts in.
+type EncryptionMode string
+
+const (
+	// EncryptionModeDirect encrypts and decrypts every value directly against the cloud KMS CMK, one
+	// round trip per value. This is the long-standing behavior and remains the default.
+	EncryptionModeDirect EncryptionMode = ""
+	// EncryptionModeEnvelope encrypts values locally with a per-stack data encryption key (DEK) that is
+	// itself wrapped by the CMK, so only the DEK - not every value - needs a KMS round trip.
+	EncryptionModeEnvelope EncryptionMode = "envelope"
+)
+
+// envelopeCiphertextPrefix marks a value as envelope-encrypted (AES-GCM under a per-stack data
+// encryption key) rather than encrypted directly against the cloud KMS CMK. Decrypters use this prefix
+// to auto-detect which path to take, so a stack can move to `encryptionmode: envelope` without
+// invalidating ciphertext already written under the old, direct format.
+const envelopeCiphertextPrefix = "v1:envelope:"
+
+func isEnvelopeCiphertext(ciphertext string) bool {
+	return strings.HasPrefix(ciphertext, envelopeCiphertextPrefix)
+}
+
+// generateDEK returns a fresh random 256-bit AES data encryption key.
+func generateDEK() ([]byte, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, errors.Wrap(err, "generating data encryption key")
+	}
+	return dek, nil
+}
+
+func encryptEnvelope(dek []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return envelopeCiphertextPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptEnvelope(dek []byte, ciphertext string) (string, error) {
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return "", err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, envelopeCiphertextPrefix))
+	if err != nil {
+		return "", errors.Wrap(err, "decoding envelope ciphertext")
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", errors.New("envelope ciphertext is too short")
+	}
+	nonce, sealed := raw[:gcm.NonceSize()], raw[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "decrypting envelope ciphertext")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(dek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, errors.Wrap(err, "constructing AES cipher for data encryption key")
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,66 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	dek, err := generateDEK()
+	require.NoError(t, err)
+
+	ciphertext, err := encryptEnvelope(dek, "hunter2")
+	require.NoError(t, err)
+	assert.True(t, isEnvelopeCiphertext(ciphertext))
+	assert.NotContains(t, ciphertext, "hunter2")
+
+	plaintext, err := decryptEnvelope(dek, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", plaintext)
+}
+
+func TestEnvelopeRoundTripEmptyPlaintext(t *testing.T) {
+	dek, err := generateDEK()
+	require.NoError(t, err)
+
+	ciphertext, err := encryptEnvelope(dek, "")
+	require.NoError(t, err)
+
+	plaintext, err := decryptEnvelope(dek, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "", plaintext)
+}
+
+func TestEnvelopeDecryptWithWrongKeyFails(t *testing.T) {
+	dek, err := generateDEK()
+	require.NoError(t, err)
+	otherDEK, err := generateDEK()
+	require.NoError(t, err)
+
+	ciphertext, err := encryptEnvelope(dek, "hunter2")
+	require.NoError(t, err)
+
+	_, err = decryptEnvelope(otherDEK, ciphertext)
+	assert.Error(t, err)
+}
+
+func TestIsEnvelopeCiphertext(t *testing.T) {
+	assert.False(t, isEnvelopeCiphertext("v1:aeadsha256:notenvelope"))
+	assert.True(t, isEnvelopeCiphertext(envelopeCiphertextPrefix+"abc123"))
+}
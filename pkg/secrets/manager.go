@@ -0,0 +1,78 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secrets builds the secrets manager for a stack's `--secrets-provider` URL: the handful of
+// providers that ship in this repo (`default`, `passphrase`, `awskms`, `azurekeyvault`, `gcpkms`,
+// `hashivault`), plus any third-party provider served by a `pulumi-secrets-<scheme>` plugin binary.
+package secrets
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource/config"
+)
+
+// Manager knows how to encrypt and decrypt values for a single stack, and how to persist whatever
+// state (a KMS key ARN, a wrapped data key, ...) it needs to do so again later.
+type Manager interface {
+	// Type is the provider kind this manager was constructed for, e.g. "passphrase" or "awskms".
+	Type() string
+	// State is the provider-specific state that should be persisted in Pulumi.<stack>.yaml so a later
+	// invocation can reconstruct an equivalent Manager without any additional user input.
+	State() json.RawMessage
+	// Encrypter returns the config.Encrypter this manager uses to seal config and state values.
+	Encrypter() config.Encrypter
+	// Decrypter returns the config.Decrypter this manager uses to open config and state values it (or
+	// an equivalent manager for the same provider state) previously sealed.
+	Decrypter() config.Decrypter
+}
+
+// ctor constructs a Manager from the full `--secrets-provider` URL for a built-in provider scheme.
+// mode and state come from the stack's Pulumi.<stack>.yaml: mode lets cloud-backed providers choose
+// between direct and envelope encryption, and state (nil for a brand new provider) is whatever that
+// provider previously returned from Manager.State, e.g. a wrapped data encryption key.
+type ctor func(secretsProviderURL string, mode EncryptionMode, state json.RawMessage) (Manager, error)
+
+var builtins = map[string]ctor{}
+
+// RegisterBuiltin registers the constructor for a secrets provider scheme that ships in this repo.
+// Each built-in provider (passphrase, awskms, azurekeyvault, gcpkms, hashivault) calls this from its own
+// init(), so NewManager never needs to know about them directly.
+func RegisterBuiltin(scheme string, new ctor) {
+	builtins[scheme] = new
+}
+
+// NewManager builds the Manager for the given `--secrets-provider` URL, in direct encryption mode and
+// with no prior provider state. Built-in schemes are constructed in-process; any other scheme is dispatched to a
+// `pulumi-secrets-<scheme>` plugin binary, provided one can be found on PATH or in the plugin cache.
+func NewManager(secretsProviderURL string) (Manager, error) {
+	return NewManagerWithState(secretsProviderURL, EncryptionModeDirect, nil)
+}
+
+// NewManagerWithState builds the Manager for the given `--secrets-provider` URL with the given
+// encryption mode and provider state. A stack's previously-persisted state reconstructs the same key
+// material; a nil state (as a `change-secrets-provider` rotation or dry run passes for the new side)
+// mints fresh key material where the provider keeps any.
+func NewManagerWithState(secretsProviderURL string, mode EncryptionMode, state json.RawMessage) (Manager, error) {
+	scheme, err := schemeOf(secretsProviderURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if new, ok := builtins[scheme]; ok {
+		return new(secretsProviderURL, mode, state)
+	}
+
+	return newPluginManager(scheme, secretsProviderURL)
+}
@@ -0,0 +1,84 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource/config"
+)
+
+func init() {
+	RegisterBuiltin("passphrase", newPassphraseManager)
+}
+
+// passphraseState is what a passphraseManager persists in Pulumi.<stack>.yaml: the salt used to derive
+// the symmetric key from PULUMI_CONFIG_PASSPHRASE, so a later invocation with the same passphrase
+// reconstructs the same key.
+type passphraseState struct {
+	Salt string `json:"salt"`
+}
+
+// newPassphraseManager builds a Manager whose key is derived from the PULUMI_CONFIG_PASSPHRASE
+// environment variable and a per-stack salt. A fresh salt is generated the first time a stack rotates
+// onto this provider; state reconstructs the same salt (and therefore the same key) on every later run.
+func newPassphraseManager(secretsProviderURL string, mode EncryptionMode, state json.RawMessage) (Manager, error) {
+	phrase, ok := os.LookupEnv("PULUMI_CONFIG_PASSPHRASE")
+	if !ok || phrase == "" {
+		return nil, errors.New("PULUMI_CONFIG_PASSPHRASE must be set to use the passphrase secrets provider")
+	}
+
+	var ps passphraseState
+	if len(state) > 0 {
+		if err := json.Unmarshal(state, &ps); err != nil {
+			return nil, errors.Wrap(err, "unmarshalling passphrase provider state")
+		}
+	} else {
+		salt := make([]byte, 8)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, errors.Wrap(err, "generating passphrase salt")
+		}
+		ps.Salt = base64.StdEncoding.EncodeToString(salt)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(ps.Salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding passphrase salt")
+	}
+
+	crypter := config.NewSymmetricCrypterFromPassphrase(phrase, salt)
+	return &passphraseManager{state: ps, crypter: crypter}, nil
+}
+
+type passphraseManager struct {
+	state   passphraseState
+	crypter config.Crypter
+}
+
+func (m *passphraseManager) Type() string { return "passphrase" }
+
+func (m *passphraseManager) State() json.RawMessage {
+	state, _ := json.Marshal(m.state)
+	return state
+}
+
+func (m *passphraseManager) Encrypter() config.Encrypter { return m.crypter }
+func (m *passphraseManager) Decrypter() config.Decrypter { return m.crypter }
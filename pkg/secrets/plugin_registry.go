@@ -0,0 +1,146 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os/exec"
+
+	"github.com/pkg/errors"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource/config"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource/plugin"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/workspace"
+)
+
+// schemeOf returns the URL scheme of a `--secrets-provider` value, e.g. "awskms" for
+// "awskms://alias/ExampleAlias?region=us-east-1", or "default"/"passphrase" unchanged since those two
+// are passed as bare keywords rather than URLs.
+func schemeOf(secretsProviderURL string) (string, error) {
+	switch secretsProviderURL {
+	case "default", "passphrase":
+		return secretsProviderURL, nil
+	}
+
+	u, err := url.Parse(secretsProviderURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "parsing secrets provider %q", secretsProviderURL)
+	}
+	if u.Scheme == "" {
+		return "", errors.Errorf("secrets provider %q has no URL scheme", secretsProviderURL)
+	}
+	return u.Scheme, nil
+}
+
+// ValidateProvider checks that secretsProviderURL names a provider this CLI can actually construct: a
+// built-in scheme registered in this package, or a scheme claimed by an installed
+// `pulumi-secrets-<scheme>` plugin binary. validateSecretsProvider calls this before any rotation work
+// begins so a typo or a missing plugin fails fast instead of partway through a rotation.
+func ValidateProvider(secretsProviderURL string) error {
+	scheme, err := schemeOf(secretsProviderURL)
+	if err != nil {
+		return err
+	}
+	if !HasPlugin(scheme) {
+		return errors.Errorf(
+			"unknown secrets provider scheme %q: no built-in provider and no %q plugin found on PATH "+
+				"or in the plugin cache", scheme, pluginBinaryName(scheme))
+	}
+	return nil
+}
+
+// pluginBinaryName is the name of the plugin binary a scheme not built into this repo must ship as.
+func pluginBinaryName(scheme string) string {
+	return fmt.Sprintf("pulumi-secrets-%s", scheme)
+}
+
+// HasPlugin reports whether scheme can be served: it is true for a built-in scheme registered in this
+// package, and otherwise when a `pulumi-secrets-<scheme>` binary can be found, either on PATH or in the
+// Pulumi plugin cache. validateSecretsProvider uses this to accept any scheme with a plugin installed,
+// not just the hard-coded built-in list.
+func HasPlugin(scheme string) bool {
+	if _, ok := builtins[scheme]; ok {
+		return true
+	}
+
+	name := pluginBinaryName(scheme)
+	if _, err := exec.LookPath(name); err == nil {
+		return true
+	}
+	// GetPluginPath builds the binary name itself from (kind, scheme) as "pulumi-<kind>-<scheme>"; pass
+	// the bare scheme here, not the already-prefixed pluginBinaryName, or the lookup doubly prefixes it.
+	if _, err := workspace.GetPluginPath(workspace.SecretsPlugin, scheme, nil); err == nil {
+		return true
+	}
+	return false
+}
+
+// newPluginManager builds a Manager backed by a `pulumi-secrets-<scheme>` plugin binary.
+func newPluginManager(scheme, secretsProviderURL string) (Manager, error) {
+	if !HasPlugin(scheme) {
+		return nil, errors.Errorf(
+			"unknown secrets provider scheme %q: no built-in provider and no %q plugin found on PATH "+
+				"or in the plugin cache", scheme, pluginBinaryName(scheme))
+	}
+
+	p, err := plugin.NewSecretsProviderPlugin(nil /* default host */, scheme, secretsProviderURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "starting secrets provider plugin for scheme %q", scheme)
+	}
+
+	return &pluginManager{scheme: scheme, url: secretsProviderURL, plugin: p}, nil
+}
+
+// pluginManager adapts a config.SecretsProviderPlugin, served by an external `pulumi-secrets-<scheme>`
+// binary, to the Manager interface.
+type pluginManager struct {
+	scheme string
+	url    string
+	plugin config.SecretsProviderPlugin
+}
+
+func (m *pluginManager) Type() string { return m.scheme }
+
+func (m *pluginManager) State() json.RawMessage {
+	state, _ := json.Marshal(map[string]string{"url": m.url})
+	return state
+}
+
+func (m *pluginManager) Encrypter() config.Encrypter { return &pluginCrypter{plugin: m.plugin} }
+func (m *pluginManager) Decrypter() config.Decrypter { return &pluginCrypter{plugin: m.plugin} }
+
+// pluginCrypter implements config.Encrypter and config.Decrypter by calling the plugin's Encrypt and
+// Decrypt RPCs one value at a time, so every value costs one round trip to the plugin.
+type pluginCrypter struct {
+	plugin config.SecretsProviderPlugin
+}
+
+func (c *pluginCrypter) EncryptValue(plaintext string) (string, error) {
+	ciphertexts, err := c.plugin.Encrypt([]string{plaintext})
+	if err != nil {
+		return "", err
+	}
+	return ciphertexts[0], nil
+}
+
+func (c *pluginCrypter) DecryptValue(ciphertext string) (string, error) {
+	plaintexts, err := c.plugin.Decrypt([]string{ciphertext})
+	if err != nil {
+		return "", err
+	}
+	return plaintexts[0], nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/workspace"
+)
+
+func TestSchemeOfBareKeywords(t *testing.T) {
+	scheme, err := schemeOf("default")
+	require.NoError(t, err)
+	assert.Equal(t, "default", scheme)
+
+	scheme, err = schemeOf("passphrase")
+	require.NoError(t, err)
+	assert.Equal(t, "passphrase", scheme)
+}
+
+func TestSchemeOfURL(t *testing.T) {
+	scheme, err := schemeOf("awskms://alias/ExampleAlias?region=us-east-1")
+	require.NoError(t, err)
+	assert.Equal(t, "awskms", scheme)
+}
+
+func TestSchemeOfNoScheme(t *testing.T) {
+	_, err := schemeOf("not-a-url-or-keyword")
+	assert.Error(t, err)
+}
+
+func TestHasPluginBuiltins(t *testing.T) {
+	assert.True(t, HasPlugin("default"))
+	assert.True(t, HasPlugin("passphrase"))
+	assert.True(t, HasPlugin("awskms"))
+	assert.True(t, HasPlugin("azurekeyvault"))
+	assert.True(t, HasPlugin("gcpkms"))
+	assert.True(t, HasPlugin("hashivault"))
+}
+
+func TestHasPluginUnknownScheme(t *testing.T) {
+	assert.False(t, HasPlugin("not-a-real-scheme-nobody-ships"))
+}
+
+func TestValidateProviderBuiltin(t *testing.T) {
+	assert.NoError(t, ValidateProvider("passphrase"))
+	assert.NoError(t, ValidateProvider("awskms://alias/ExampleAlias?region=us-east-1"))
+}
+
+func TestValidateProviderUnknownScheme(t *testing.T) {
+	err := ValidateProvider("doppler://workplace/config")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "doppler")
+	assert.Contains(t, err.Error(), "pulumi-secrets-doppler")
+}
+
+func TestValidateProviderInvalidURL(t *testing.T) {
+	assert.Error(t, ValidateProvider("not-a-url-or-keyword"))
+}
+
+// TestPluginBinaryNameDoesNotDoublyPrefix guards the bug HasPlugin's comment calls out: GetPluginPath
+// already builds "pulumi-<kind>-<scheme>" itself, so passing it the already-prefixed
+// pluginBinaryName(scheme) would look up "pulumi-secrets-pulumi-secrets-doppler" instead of
+// "pulumi-secrets-doppler". The binary name GetPluginPath builds from the bare scheme must therefore be
+// exactly pluginBinaryName(scheme).
+func TestPluginBinaryNameDoesNotDoublyPrefix(t *testing.T) {
+	name := pluginBinaryName("doppler")
+	assert.Equal(t, "pulumi-secrets-doppler", name)
+	assert.Equal(t, "pulumi-"+string(workspace.SecretsPlugin)+"-doppler", name)
+}
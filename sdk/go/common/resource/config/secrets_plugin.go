@@ -0,0 +1,37 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// SecretsProviderPlugin is the interface a secrets provider plugin implements so it can participate in
+// encrypting and decrypting stack config and state, without its code living in this repo. It is modeled
+// on the language and resource provider plugin interfaces: a handful of RPCs served by a long-lived
+// plugin process that the host dispatches to.
+//
+// A plugin claims a URL scheme (e.g. `doppler://...`) and ships as a binary named
+// `pulumi-secrets-<scheme>` discoverable on PATH or in the plugin cache. `Configure` is called once,
+// with the secrets provider URL the user passed to `--secrets-provider`, to let the plugin parse its own
+// path/query parameters and establish any session it needs; `Encrypt` and `Decrypt` are then called as
+// many times as needed to round-trip plaintext/ciphertext config values.
+type SecretsProviderPlugin interface {
+	// Configure is called once, before any Encrypt or Decrypt call, with the full secrets provider URL
+	// (e.g. "doppler://workplace/config") that the plugin registered its scheme for.
+	Configure(secretsProviderURL string) error
+
+	// Encrypt encrypts a batch of plaintext values and returns their ciphertext, in the same order.
+	Encrypt(plaintexts []string) ([]string, error)
+
+	// Decrypt decrypts a batch of ciphertext values previously returned by Encrypt, in the same order.
+	Decrypt(ciphertexts []string) ([]string, error)
+}
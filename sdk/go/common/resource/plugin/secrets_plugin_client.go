@@ -0,0 +1,95 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource/config"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/util/rpcutil"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/workspace"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v2/proto/go"
+)
+
+// secretsProviderPlugin implements config.SecretsProviderPlugin by dispatching to a `pulumi-secrets-*`
+// plugin binary over gRPC, the same way other plugin kinds (language runtimes, resource providers) in
+// this package are hosted: the binary is launched as a subprocess, it reports back the port its gRPC
+// server is listening on, and the host dials that port.
+type secretsProviderPlugin struct {
+	ctx    *Context
+	plug   *plugin
+	client pulumirpc.SecretsProviderClient
+}
+
+// NewSecretsProviderPlugin launches the `pulumi-secrets-<scheme>` binary on PATH (or in the plugin
+// cache) and returns a config.SecretsProviderPlugin backed by it. secretsProviderURL is the full URL
+// the user passed to `--secrets-provider`, e.g. "doppler://workplace/config"; scheme is its URL scheme.
+func NewSecretsProviderPlugin(host Host, scheme, secretsProviderURL string) (config.SecretsProviderPlugin, error) {
+	ctx, err := NewContext(nil, nil, host, nil, "", nil, false, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating plugin context for secrets provider %q", scheme)
+	}
+
+	plug, err := newPlugin(ctx, ctx.Pwd, fmt.Sprintf("pulumi-secrets-%v", scheme), workspace.SecretsPlugin,
+		[]string{"pulumi-secrets-" + scheme}, nil, []string{}, secretsPluginDialOptions)
+	if err != nil {
+		return nil, errors.Wrapf(err, "launching secrets provider plugin for scheme %q", scheme)
+	}
+
+	sp := &secretsProviderPlugin{
+		ctx:    ctx,
+		plug:   plug,
+		client: pulumirpc.NewSecretsProviderClient(plug.Conn),
+	}
+
+	if _, err := sp.client.Configure(context.Background(), &pulumirpc.ConfigureRequest{
+		SecretsProviderUrl: secretsProviderURL,
+	}); err != nil {
+		return nil, errors.Wrapf(err, "configuring secrets provider plugin for scheme %q", scheme)
+	}
+
+	return sp, nil
+}
+
+func (p *secretsProviderPlugin) Configure(secretsProviderURL string) error {
+	_, err := p.client.Configure(context.Background(), &pulumirpc.ConfigureRequest{
+		SecretsProviderUrl: secretsProviderURL,
+	})
+	return err
+}
+
+func (p *secretsProviderPlugin) Encrypt(plaintexts []string) ([]string, error) {
+	resp, err := p.client.Encrypt(context.Background(), &pulumirpc.EncryptRequest{Plaintexts: plaintexts})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Ciphertexts, nil
+}
+
+func (p *secretsProviderPlugin) Decrypt(ciphertexts []string) ([]string, error) {
+	resp, err := p.client.Decrypt(context.Background(), &pulumirpc.DecryptRequest{Ciphertexts: ciphertexts})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Plaintexts, nil
+}
+
+var secretsPluginDialOptions = []grpc.DialOption{
+	rpcutil.GrpcChannelOptions(),
+}
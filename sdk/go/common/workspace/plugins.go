@@ -0,0 +1,95 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/blang/semver"
+	"github.com/pkg/errors"
+)
+
+// PluginKind represents the kind of a plugin that may be dynamically loaded and used by Pulumi.
+type PluginKind string
+
+const (
+	// AnalyzerPlugin is a plugin that can be used as a resource analyzer.
+	AnalyzerPlugin PluginKind = "analyzer"
+	// LanguagePlugin is a plugin that can be used as a language host.
+	LanguagePlugin PluginKind = "language"
+	// ResourcePlugin is a plugin that can be used as a resource provider.
+	ResourcePlugin PluginKind = "resource"
+	// SecretsPlugin is a `pulumi-secrets-<scheme>` plugin implementing a third-party secrets provider
+	// (see config.SecretsProviderPlugin), dispatched to by the `pkg/secrets` registry for any
+	// `--secrets-provider` scheme that isn't built into this repo.
+	SecretsPlugin PluginKind = "secrets"
+)
+
+// GetPluginPath finds the path to a plugin of the given kind and name in the plugin cache
+// (`~/.pulumi/plugins`). If version is nil, the newest installed version is used. It does not search
+// PATH; callers that also want to fall back to PATH (as change-secrets-provider's plugin discovery
+// does) should try exec.LookPath first.
+func GetPluginPath(kind PluginKind, name string, version *semver.Version) (string, error) {
+	dir, err := pluginCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	prefix := string(kind) + "-" + name
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", errors.Wrapf(err, "reading plugin cache %q", dir)
+	}
+
+	var best string
+	var bestVersion semver.Version
+	for _, e := range entries {
+		if !e.IsDir() || !hasPrefixDash(e.Name(), prefix) {
+			continue
+		}
+		v, err := semver.ParseTolerant(e.Name()[len(prefix)+1:])
+		if err != nil {
+			continue
+		}
+		if version != nil && !v.EQ(*version) {
+			continue
+		}
+		if best == "" || v.GT(bestVersion) {
+			best, bestVersion = e.Name(), v
+		}
+	}
+	if best == "" {
+		return "", errors.Errorf("no %s plugin %q found in %q", kind, name, dir)
+	}
+
+	bin := filepath.Join(dir, best, "pulumi-"+string(kind)+"-"+name)
+	if _, err := os.Stat(bin); err != nil {
+		return "", errors.Wrapf(err, "plugin binary %q", bin)
+	}
+	return bin, nil
+}
+
+func hasPrefixDash(s, prefix string) bool {
+	return len(s) > len(prefix) && s[:len(prefix)] == prefix && s[len(prefix)] == '-'
+}
+
+func pluginCacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "finding home directory")
+	}
+	return filepath.Join(home, ".pulumi", "plugins"), nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workspace
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource/config"
+)
+
+// ProjectStack holds the contents of a stack's Pulumi.<stack>.yaml: its config, and whatever a stack's
+// secrets provider needs to decrypt that config again later.
+type ProjectStack struct {
+	// SecretsProvider is the `--secrets-provider` URL this stack was last rotated onto, e.g.
+	// "awskms://alias/ExampleAlias?region=us-east-1", or the bare keyword "default"/"passphrase".
+	SecretsProvider string `json:"secretsprovider,omitempty" yaml:"secretsprovider,omitempty"`
+	// EncryptionSalt is the salt historically used by the passphrase provider. New stacks persist their
+	// salt inside SecretsProviderState instead; this field is only read for backwards compatibility.
+	EncryptionSalt string `json:"encryptionsalt,omitempty" yaml:"encryptionsalt,omitempty"`
+	// EncryptedKey is the data key historically used by the cloud KMS providers. New stacks persist their
+	// wrapped key inside SecretsProviderState instead; this field is only read for backwards compatibility.
+	EncryptedKey string `json:"encryptedkey,omitempty" yaml:"encryptedkey,omitempty"`
+	// EncryptionMode selects how a cloud-backed secrets provider encrypts this stack's values: "" (the
+	// default) encrypts every value directly against the provider's CMK, while "envelope" encrypts
+	// locally under a per-stack data encryption key that the CMK only needs to wrap once. See
+	// secrets.EncryptionMode.
+	EncryptionMode string `json:"encryptionmode,omitempty" yaml:"encryptionmode,omitempty"`
+	// SecretsProviderState is whatever SecretsProvider's Manager.State returned the last time this stack's
+	// secrets provider was created or rotated, e.g. a passphrase salt or a wrapped data encryption key. A
+	// later invocation passes it back into secrets.NewManagerWithState to reconstruct an equivalent
+	// Manager without asking the user for anything again.
+	SecretsProviderState json.RawMessage `json:"secretsproviderstate,omitempty" yaml:"secretsproviderstate,omitempty"`
+	// Config is this stack's configuration, keyed by <namespace>:<key>.
+	Config config.Map `json:"config,omitempty" yaml:"config,omitempty"`
+}
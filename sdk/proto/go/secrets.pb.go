@@ -0,0 +1,112 @@
+// Hand-written Go bindings for sdk/proto/secrets.proto.
+//
+// These aren't real protoc-gen-go output: this repo doesn't vendor protoc/protoc-gen-go, so there's no
+// `make generate` step that can produce or verify this file yet. It mirrors the shape protoc-gen-go would
+// emit for secrets.proto's four messages (field names, tags, and the Reset/String/ProtoMessage trio that
+// satisfies proto.Message), but skips the registry bookkeeping (proto.RegisterType/RegisterFile, gzipped
+// file-descriptor bytes) that a real run would add, since nothing in this repo reads it. If protoc-gen-go
+// tooling is added later, regenerate from secrets.proto and delete this file by hand - don't let a
+// generator silently overwrite it first.
+// source: secrets.proto
+
+package pulumirpc
+
+import (
+	context "context"
+	fmt "fmt"
+
+	proto "github.com/golang/protobuf/proto"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = context.Background
+
+// ConfigureRequest is the request for SecretsProvider.Configure.
+type ConfigureRequest struct {
+	// The full secrets provider URL, e.g. "doppler://workplace/config".
+	SecretsProviderUrl string `protobuf:"bytes,1,opt,name=secrets_provider_url,json=secretsProviderUrl,proto3" json:"secrets_provider_url,omitempty"`
+}
+
+func (m *ConfigureRequest) Reset()         { *m = ConfigureRequest{} }
+func (m *ConfigureRequest) String() string { return proto.CompactTextString(m) }
+func (*ConfigureRequest) ProtoMessage()    {}
+
+func (m *ConfigureRequest) GetSecretsProviderUrl() string {
+	if m != nil {
+		return m.SecretsProviderUrl
+	}
+	return ""
+}
+
+// ConfigureResponse is the (empty) response for SecretsProvider.Configure.
+type ConfigureResponse struct{}
+
+func (m *ConfigureResponse) Reset()         { *m = ConfigureResponse{} }
+func (m *ConfigureResponse) String() string { return proto.CompactTextString(m) }
+func (*ConfigureResponse) ProtoMessage()    {}
+
+// EncryptRequest is the request for SecretsProvider.Encrypt.
+type EncryptRequest struct {
+	Plaintexts []string `protobuf:"bytes,1,rep,name=plaintexts,proto3" json:"plaintexts,omitempty"`
+}
+
+func (m *EncryptRequest) Reset()         { *m = EncryptRequest{} }
+func (m *EncryptRequest) String() string { return proto.CompactTextString(m) }
+func (*EncryptRequest) ProtoMessage()    {}
+
+func (m *EncryptRequest) GetPlaintexts() []string {
+	if m != nil {
+		return m.Plaintexts
+	}
+	return nil
+}
+
+// EncryptResponse is the response for SecretsProvider.Encrypt.
+type EncryptResponse struct {
+	Ciphertexts []string `protobuf:"bytes,1,rep,name=ciphertexts,proto3" json:"ciphertexts,omitempty"`
+}
+
+func (m *EncryptResponse) Reset()         { *m = EncryptResponse{} }
+func (m *EncryptResponse) String() string { return proto.CompactTextString(m) }
+func (*EncryptResponse) ProtoMessage()    {}
+
+func (m *EncryptResponse) GetCiphertexts() []string {
+	if m != nil {
+		return m.Ciphertexts
+	}
+	return nil
+}
+
+// DecryptRequest is the request for SecretsProvider.Decrypt.
+type DecryptRequest struct {
+	Ciphertexts []string `protobuf:"bytes,1,rep,name=ciphertexts,proto3" json:"ciphertexts,omitempty"`
+}
+
+func (m *DecryptRequest) Reset()         { *m = DecryptRequest{} }
+func (m *DecryptRequest) String() string { return proto.CompactTextString(m) }
+func (*DecryptRequest) ProtoMessage()    {}
+
+func (m *DecryptRequest) GetCiphertexts() []string {
+	if m != nil {
+		return m.Ciphertexts
+	}
+	return nil
+}
+
+// DecryptResponse is the response for SecretsProvider.Decrypt.
+type DecryptResponse struct {
+	Plaintexts []string `protobuf:"bytes,1,rep,name=plaintexts,proto3" json:"plaintexts,omitempty"`
+}
+
+func (m *DecryptResponse) Reset()         { *m = DecryptResponse{} }
+func (m *DecryptResponse) String() string { return proto.CompactTextString(m) }
+func (*DecryptResponse) ProtoMessage()    {}
+
+func (m *DecryptResponse) GetPlaintexts() []string {
+	if m != nil {
+		return m.Plaintexts
+	}
+	return nil
+}